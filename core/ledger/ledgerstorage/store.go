@@ -0,0 +1,257 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgerstorage
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/ledger/blkstorage"
+	"github.com/hyperledger/fabric/common/ledger/blkstorage/fsblkstorage"
+	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/pvtdatapolicy"
+	"github.com/hyperledger/fabric/core/ledger/pvtdatastorage"
+)
+
+const maxBlockFileSize = 64 * 1024 * 1024
+
+var logger = flogging.MustGetLogger("ledgerstorage")
+
+var attrsToIndex = []blkstorage.IndexableAttr{
+	blkstorage.IndexableAttrBlockHash,
+	blkstorage.IndexableAttrBlockNum,
+	blkstorage.IndexableAttrTxID,
+	blkstorage.IndexableAttrBlockNumTranNum,
+	blkstorage.IndexableAttrBlockTxID,
+	blkstorage.IndexableAttrTxValidationCode,
+}
+
+// PvtdataHashMismatch is returned by APIs that reconcile externally supplied
+// private data against the hashes recorded on chain, for the entries whose
+// hash did not match. Callers typically use this to blacklist the peer that
+// supplied the offending data.
+type PvtdataHashMismatch struct {
+	BlockNum, TxNum          uint64
+	Namespace, Collection    string
+	ExpectedHash, ActualHash []byte
+}
+
+// Provider encapsulates two providers: 1) block store provider, and 2) and pvt data store provider
+type Provider struct {
+	blkStoreProvider     blkstorage.BlockStoreProvider
+	pvtdataStoreProvider pvtdatastorage.Provider
+	metricsProvider      metrics.Provider
+}
+
+// NewProvider instantiates a new Provider
+func NewProvider(blockStoreDir string, conf *pvtdatastorage.PrivateDataConfig, metricsProvider metrics.Provider) *Provider {
+	indexConfig := &blkstorage.IndexConfig{AttrsToIndex: attrsToIndex}
+	blkStoreProvider := fsblkstorage.NewProvider(
+		fsblkstorage.NewConf(blockStoreDir, maxBlockFileSize),
+		indexConfig,
+		metricsProvider,
+	)
+	pvtdataStoreProvider := pvtdatastorage.NewProvider(conf)
+	return &Provider{blkStoreProvider, pvtdataStoreProvider, metricsProvider}
+}
+
+// Open opens the ledger storage for the given ledgerid
+func (p *Provider) Open(ledgerid string) (*Store, error) {
+	blockStore, err := p.blkStoreProvider.OpenBlockStore(ledgerid)
+	if err != nil {
+		return nil, err
+	}
+	pvtdataStore, err := p.pvtdataStoreProvider.OpenStore(ledgerid)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{
+		BlockStore:   blockStore,
+		pvtdataStore: pvtdataStore,
+		ledgerID:     ledgerid,
+	}
+	if err := store.init(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close closes the Provider
+func (p *Provider) Close() {
+	p.blkStoreProvider.Close()
+	p.pvtdataStoreProvider.Close()
+}
+
+// Store encapsulates block store and pvt data store, such that,
+// a `Commit` to the store commits both the block and the pvt data
+// atomically, i.e., either both are committed or none is committed
+type Store struct {
+	blkstorage.BlockStore
+	pvtdataStore *pvtdatastorage.Store
+	ledgerID     string
+
+	// commitLock serializes the writes to the block store and pvt data
+	// store so that CommitWithPvtData and CommitPvtDataOfOldBlocks never
+	// race with each other while updating the pvtdataStore.
+	commitLock sync.Mutex
+
+	// SkipPvtDataHashCheck, when set, disables the validation of a supplied
+	// pvtdata's hash against the hash recorded in the block's public rwset
+	// inside CommitWithPvtData. This exists for tests that commit synthetic
+	// pvtdata whose hash does not match; importSnapshot also sets it while
+	// replaying a snapshot whose file hashes were already verified. It must
+	// not be set otherwise in production.
+	SkipPvtDataHashCheck bool
+
+	// btlPolicy is retained, in addition to being handed to the pvtdataStore, so that
+	// ExportSnapshot can capture the BTL in effect for the collections it exports.
+	btlPolicy pvtdatapolicy.BTLPolicy
+}
+
+// Init initializes the store, including the underlying pvt data store, with the BTL policy
+func (s *Store) Init(btlPolicy pvtdatapolicy.BTLPolicy) {
+	s.pvtdataStore.Init(btlPolicy)
+	s.btlPolicy = btlPolicy
+}
+
+// init sets the pvtdataStore height in sync with the block store height, in case
+// the pvtdataStore is behind the block store (e.g., a pre-existing block store from
+// before the pvt data store was introduced). A pvtdataStore that is ahead of the
+// block store is left as it is.
+func (s *Store) init() error {
+	var blockStoreHeight uint64
+	bcInfo, err := s.BlockStore.GetBlockchainInfo()
+	if err != nil {
+		return err
+	}
+	blockStoreHeight = bcInfo.Height
+
+	pvtdataStoreHeight, err := s.pvtdataStore.LastCommittedBlockHeight()
+	if err != nil {
+		return err
+	}
+
+	if pvtdataStoreHeight < blockStoreHeight {
+		if err := s.pvtdataStore.InitLastCommittedBlock(blockStoreHeight - 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitWithPvtData commits the block and the corresponding pvt data in an atomic manner
+func (s *Store) CommitWithPvtData(blockAndPvtdata *ledger.BlockAndPvtData) error {
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+
+	block := blockAndPvtdata.Block
+
+	if !s.SkipPvtDataHashCheck {
+		if err := s.validatePvtdataHashes(block, blockAndPvtdata); err != nil {
+			return err
+		}
+	}
+
+	validTxPvtData, validTxMissingPvtData := constructPvtDataAndMissingData(blockAndPvtdata)
+
+	pvtdataStoreHt, err := s.pvtdataStore.LastCommittedBlockHeight()
+	if err != nil {
+		return err
+	}
+	if pvtdataStoreHt <= block.Header.Number {
+		if err := s.pvtdataStore.Commit(block.Header.Number, validTxPvtData, validTxMissingPvtData); err != nil {
+			return err
+		}
+	} else if pvtdataStoreHt > block.Header.Number {
+		logger.Warningf(
+			"Skipping the pvt data commit for block number [%d] as it is already committed",
+			block.Header.Number,
+		)
+	}
+
+	return s.BlockStore.AddBlock(block)
+}
+
+// GetPvtDataAndBlockByNum returns the block and the corresponding pvt data.
+// The pvt data is filtered by the ns/coll filter if the filter is not nil,
+// otherwise, all the pvt data is returned
+func (s *Store) GetPvtDataAndBlockByNum(blockNum uint64, filter ledger.PvtNsCollFilter) (*ledger.BlockAndPvtData, error) {
+	block, err := s.BlockStore.RetrieveBlockByNumber(blockNum)
+	if err != nil {
+		return nil, err
+	}
+	pvtdata, err := s.pvtdataStore.GetPvtDataByBlockNum(blockNum, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &ledger.BlockAndPvtData{Block: block, PvtData: constructPvtdataMap(pvtdata)}, nil
+}
+
+// GetPvtDataByNum returns only the pvt data corresponding to the given block number
+func (s *Store) GetPvtDataByNum(blockNum uint64, filter ledger.PvtNsCollFilter) ([]*ledger.TxPvtData, error) {
+	return s.pvtdataStore.GetPvtDataByBlockNum(blockNum, filter)
+}
+
+// GetMissingPvtDataInfoForMostRecentBlocks invokes the corresponding method on the underlying pvtdata store
+func (s *Store) GetMissingPvtDataInfoForMostRecentBlocks(maxBlock int) (ledger.MissingPvtDataInfo, error) {
+	return s.pvtdataStore.GetMissingPvtDataInfoForMostRecentBlocks(maxBlock)
+}
+
+// IsPvtStoreAheadOfBlockStore returns true when the pvt data store is ahead of the block store.
+// This can happen if a crash occurs after the pvt data is committed but before the corresponding
+// block is added to the block store.
+func (s *Store) IsPvtStoreAheadOfBlockStore() bool {
+	bcInfo, err := s.BlockStore.GetBlockchainInfo()
+	if err != nil {
+		logger.Errorf("Error while getting block store height: %s", err)
+		return false
+	}
+	pvtdataStoreHt, err := s.pvtdataStore.LastCommittedBlockHeight()
+	if err != nil {
+		logger.Errorf("Error while getting pvt data store height: %s", err)
+		return false
+	}
+	return pvtdataStoreHt > bcInfo.Height
+}
+
+// Shutdown shuts down the block store and the underlying pvt data store
+func (s *Store) Shutdown() {
+	s.BlockStore.Shutdown()
+	s.pvtdataStore.Shutdown()
+}
+
+func constructPvtdataMap(pvtdata []*ledger.TxPvtData) ledger.TxPvtDataMap {
+	if pvtdata == nil {
+		return nil
+	}
+	m := make(ledger.TxPvtDataMap)
+	for _, pvtdatum := range pvtdata {
+		m[pvtdatum.SeqInBlock] = pvtdatum
+	}
+	return m
+}
+
+func constructPvtDataAndMissingData(blockAndPvtdata *ledger.BlockAndPvtData) ([]*ledger.TxPvtData, ledger.TxMissingPvtDataMap) {
+	var pvtData []*ledger.TxPvtData
+	missingPvtData := make(ledger.TxMissingPvtDataMap)
+
+	numTxs := uint64(len(blockAndPvtdata.Block.Data.Data))
+
+	for txNum := uint64(0); txNum < numTxs; txNum++ {
+		if txPvtData, ok := blockAndPvtdata.PvtData[txNum]; ok {
+			pvtData = append(pvtData, txPvtData)
+		}
+
+		if txMissingPvtData, ok := blockAndPvtdata.MissingPvtData[txNum]; ok {
+			for _, missingData := range txMissingPvtData {
+				missingPvtData.Add(txNum, missingData.Namespace, missingData.Collection, missingData.IsEligible)
+			}
+		}
+	}
+	return pvtData, missingPvtData
+}
@@ -0,0 +1,41 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgerstorage
+
+import (
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+// validatePvtdataHashes checks, for every transaction in blockAndPvtdata.PvtData, that the
+// supplied pvt write-set hashes to the value recorded in the block's public rwset. Collections
+// that fail the check are dropped from the commit and recorded instead as missing pvtdata
+// (eligible for later reconciliation), so that CommitWithPvtData never persists pvtdata that
+// does not match what was ordered into the block.
+func (s *Store) validatePvtdataHashes(block *common.Block, blockAndPvtdata *ledger.BlockAndPvtData) error {
+	if blockAndPvtdata.MissingPvtData == nil {
+		blockAndPvtdata.MissingPvtData = make(ledger.TxMissingPvtDataMap)
+	}
+
+	for txNum, txPvtData := range blockAndPvtdata.PvtData {
+		mismatches, err := s.validateAndTrimTxPvtData(block, txPvtData)
+		if err != nil {
+			return err
+		}
+		for _, mismatch := range mismatches {
+			logger.Warningf(
+				"Pvtdata hash mismatch for block [%d], tx [%d], ns [%s], coll [%s] -- dropping from commit and marking as missing",
+				mismatch.BlockNum, mismatch.TxNum, mismatch.Namespace, mismatch.Collection,
+			)
+			blockAndPvtdata.MissingPvtData.Add(txNum, mismatch.Namespace, mismatch.Collection, true)
+		}
+		if len(txPvtData.WriteSet.NsPvtRwset) == 0 {
+			delete(blockAndPvtdata.PvtData, txNum)
+		}
+	}
+	return nil
+}
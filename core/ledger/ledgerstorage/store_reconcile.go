@@ -0,0 +1,137 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgerstorage
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/rwset"
+)
+
+// CommitPvtDataOfOldBlocks commits the pvtData (i.e., previously missing data) of old blocks.
+// The parameter `reconciledPvtdata` is a map from block number to the list of transaction
+// pvtdata that a reconciler collected from other peers for that block. For each entry, the hash
+// of the supplied pvt write-set is compared against the hash recorded in the corresponding
+// block's public rwset; only entries whose hash matches are committed to the pvtdataStore (and
+// removed from the missing-pvtdata bookkeeping there). Entries whose hash does not match are
+// left as missing and are reported back to the caller so that it can blacklist the peer that
+// supplied them. The operation is idempotent: pvtdata that has already been committed, or whose
+// BTL-based expiry has already passed, is silently skipped.
+func (s *Store) CommitPvtDataOfOldBlocks(reconciledPvtdata map[uint64][]*ledger.TxPvtData) ([]*PvtdataHashMismatch, error) {
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+
+	var hashMismatches []*PvtdataHashMismatch
+	validatedPvtdata := make(map[uint64][]*ledger.TxPvtData)
+
+	for blkNum, txsPvtData := range reconciledPvtdata {
+		block, err := s.BlockStore.RetrieveBlockByNumber(blkNum)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, txPvtData := range txsPvtData {
+			// trim a copy so that the caller's TxPvtData keeps its full write-set
+			txPvtData = &ledger.TxPvtData{SeqInBlock: txPvtData.SeqInBlock, WriteSet: txPvtData.WriteSet}
+			mismatches, err := s.validateAndTrimTxPvtData(block, txPvtData)
+			if err != nil {
+				return nil, err
+			}
+			hashMismatches = append(hashMismatches, mismatches...)
+			if len(txPvtData.WriteSet.NsPvtRwset) > 0 {
+				validatedPvtdata[blkNum] = append(validatedPvtdata[blkNum], txPvtData)
+			}
+		}
+	}
+
+	if err := s.pvtdataStore.CommitPvtDataOfOldBlocks(validatedPvtdata); err != nil {
+		return nil, err
+	}
+	return hashMismatches, nil
+}
+
+// validateAndTrimTxPvtData compares the hash of each ns/coll in txPvtData against the hash
+// recorded on chain for the given block and transaction, trimming out (and reporting) any
+// collection whose hash does not match. txPvtData.WriteSet is repointed at a newly built
+// write-set containing only the validated collections; the original write-set object is left
+// untouched so that callers sharing it across multiple TxPvtData entries are not affected.
+func (s *Store) validateAndTrimTxPvtData(block *common.Block, txPvtData *ledger.TxPvtData) ([]*PvtdataHashMismatch, error) {
+	expectedHashes, err := extractPvtdataHashes(block, txPvtData.SeqInBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []*PvtdataHashMismatch
+	var validatedNsRwset []*rwset.NsPvtReadWriteSet
+	for _, nsRwset := range txPvtData.WriteSet.NsPvtRwset {
+		var validatedColls []*rwset.CollectionPvtReadWriteSet
+		for _, collRwset := range nsRwset.CollectionPvtRwset {
+			key := [2]string{nsRwset.Namespace, collRwset.CollectionName}
+			expectedHash, ok := expectedHashes[key]
+			if !ok {
+				// nothing recorded on chain for this ns/coll -- ignore silently, it
+				// is not something the reconciler asked for
+				continue
+			}
+			actualHash := sha256Sum(collRwset.Rwset)
+			if !bytes.Equal(expectedHash, actualHash) {
+				mismatches = append(mismatches, &PvtdataHashMismatch{
+					BlockNum:     block.Header.Number,
+					TxNum:        txPvtData.SeqInBlock,
+					Namespace:    nsRwset.Namespace,
+					Collection:   collRwset.CollectionName,
+					ExpectedHash: expectedHash,
+					ActualHash:   actualHash,
+				})
+				continue
+			}
+			validatedColls = append(validatedColls, collRwset)
+		}
+		if len(validatedColls) > 0 {
+			validatedNsRwset = append(validatedNsRwset, &rwset.NsPvtReadWriteSet{
+				Namespace:          nsRwset.Namespace,
+				CollectionPvtRwset: validatedColls,
+			})
+		}
+	}
+	txPvtData.WriteSet = &rwset.TxPvtReadWriteSet{
+		DataModel:  txPvtData.WriteSet.DataModel,
+		NsPvtRwset: validatedNsRwset,
+	}
+	return mismatches, nil
+}
+
+// extractPvtdataHashes returns, for the given transaction in the given block, the recorded
+// pvtdata hash for every ns/coll present in the transaction's hashed rwset.
+func extractPvtdataHashes(block *common.Block, txNum uint64) (map[[2]string][]byte, error) {
+	if txNum >= uint64(len(block.Data.Data)) {
+		return nil, errors.Errorf("transaction number %d is out of range for block %d", txNum, block.Header.Number)
+	}
+	txRwSet, err := rwsetutil.TxRwSetFromEnvelopeBytes(block.Data.Data[txNum])
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[[2]string][]byte)
+	for _, nsRwSet := range txRwSet.NsRwSets {
+		for _, collHashedRwSet := range nsRwSet.CollHashedRwSets {
+			hashes[[2]string{nsRwSet.NameSpace, collHashedRwSet.CollectionName}] = collHashedRwSet.PvtRwSetHash
+		}
+	}
+	return hashes, nil
+}
+
+func sha256Sum(b []byte) []byte {
+	h := sha256.Sum256(b)
+	return h[:]
+}
@@ -0,0 +1,321 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ledgerstorage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/ledger/rwset"
+)
+
+const (
+	snapshotBlocksFileName   = "blocks.data"
+	snapshotPvtdataFileName  = "pvtdata.data"
+	snapshotMetadataFileName = "metadata.json"
+)
+
+// SnapshotMetadata describes a snapshot produced by Store.ExportSnapshot: enough for
+// Provider.CreateFromSnapshot to verify the files it is about to trust, and for an operator
+// to inspect a snapshot's provenance before using it to bootstrap a new peer.
+type SnapshotMetadata struct {
+	LedgerHeight    uint64 `json:"ledger_height"`
+	LastBlockHash   []byte `json:"last_block_hash"`
+	BlocksFileHash  []byte `json:"blocks_file_hash"`
+	PvtdataFileHash []byte `json:"pvtdata_file_hash"`
+
+	// BTLPolicy records, for every ns/coll pair that appears in the exported pvt data, the
+	// BTL (in blocks) that was in effect at export time, keyed as "namespace/collection".
+	BTLPolicy map[string]uint64 `json:"btl_policy,omitempty"`
+}
+
+// ExportSnapshot streams the full contents of the store -- blocks, pvt data, and a BTL policy
+// snapshot -- to three files under dir, in block-number order, so that an operator can bootstrap
+// a new peer from a trusted one without replaying every block through the transaction flow.
+func (s *Store) ExportSnapshot(dir string) (*SnapshotMetadata, error) {
+	bcInfo, err := s.BlockStore.GetBlockchainInfo()
+	if err != nil {
+		return nil, err
+	}
+	height := bcInfo.Height
+
+	blocksHash, err := s.exportBlocks(filepath.Join(dir, snapshotBlocksFileName), height)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error exporting blocks")
+	}
+	pvtdataHash, btlPolicySnapshot, err := s.exportPvtdata(filepath.Join(dir, snapshotPvtdataFileName), height)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error exporting pvt data")
+	}
+
+	metadata := &SnapshotMetadata{
+		LedgerHeight:    height,
+		LastBlockHash:   bcInfo.CurrentBlockHash,
+		BlocksFileHash:  blocksHash,
+		PvtdataFileHash: pvtdataHash,
+		BTLPolicy:       btlPolicySnapshot,
+	}
+	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotMetadataFileName), metadataBytes, 0644); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// exportBlocks writes every block, in block-number order, as a length-prefixed marshaled
+// common.Block to file, returning the SHA-256 of the file's contents.
+func (s *Store) exportBlocks(file string, height uint64) ([]byte, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	w := io.MultiWriter(f, hasher)
+	for blockNum := uint64(0); blockNum < height; blockNum++ {
+		block, err := s.BlockStore.RetrieveBlockByNumber(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		blockBytes, err := proto.Marshal(block)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeLengthPrefixed(w, blockBytes); err != nil {
+			return nil, err
+		}
+	}
+	return hasher.Sum(nil), nil
+}
+
+// exportPvtdata writes every TxPvtData, in (blockNum, txNum) order, as a length-prefixed
+// record to file, and collects the BTL for every ns/coll it encounters along the way.
+func (s *Store) exportPvtdata(file string, height uint64) ([]byte, map[string]uint64, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	w := io.MultiWriter(f, hasher)
+	btlPolicySnapshot := map[string]uint64{}
+
+	for blockNum := uint64(0); blockNum < height; blockNum++ {
+		pvtdata, err := s.pvtdataStore.GetPvtDataByBlockNum(blockNum, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, txPvtData := range pvtdata {
+			pvtDataBytes, err := proto.Marshal(txPvtData.WriteSet)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := writeSnapshotPvtdataRecord(w, blockNum, txPvtData.SeqInBlock, pvtDataBytes); err != nil {
+				return nil, nil, err
+			}
+			for _, nsRwset := range txPvtData.WriteSet.NsPvtRwset {
+				for _, collRwset := range nsRwset.CollectionPvtRwset {
+					key := nsRwset.Namespace + "/" + collRwset.CollectionName
+					if _, ok := btlPolicySnapshot[key]; ok || s.btlPolicy == nil {
+						continue
+					}
+					btl, err := s.btlPolicy.GetBTL(nsRwset.Namespace, collRwset.CollectionName)
+					if err != nil {
+						return nil, nil, err
+					}
+					btlPolicySnapshot[key] = btl
+				}
+			}
+		}
+	}
+	return hasher.Sum(nil), btlPolicySnapshot, nil
+}
+
+// CreateFromSnapshot bootstraps a new ledger, ledgerID, from the snapshot previously produced
+// by Store.ExportSnapshot in dir. It refuses to run against a ledger that already has blocks,
+// verifies the snapshot's file hashes before trusting its contents, then replays the blocks and
+// pvt data in order so that the resulting store is indistinguishable from one built by
+// committing each block individually.
+func (p *Provider) CreateFromSnapshot(dir string, ledgerID string) error {
+	metadataBytes, err := ioutil.ReadFile(filepath.Join(dir, snapshotMetadataFileName))
+	if err != nil {
+		return err
+	}
+	metadata := &SnapshotMetadata{}
+	if err := json.Unmarshal(metadataBytes, metadata); err != nil {
+		return err
+	}
+	if err := verifyFileHash(filepath.Join(dir, snapshotBlocksFileName), metadata.BlocksFileHash); err != nil {
+		return errors.WithMessage(err, "blocks snapshot file failed verification")
+	}
+	if err := verifyFileHash(filepath.Join(dir, snapshotPvtdataFileName), metadata.PvtdataFileHash); err != nil {
+		return errors.WithMessage(err, "pvtdata snapshot file failed verification")
+	}
+
+	store, err := p.Open(ledgerID)
+	if err != nil {
+		return err
+	}
+	defer store.Shutdown()
+
+	bcInfo, err := store.BlockStore.GetBlockchainInfo()
+	if err != nil {
+		return err
+	}
+	if bcInfo.Height != 0 {
+		return errors.Errorf("ledger [%s] is not empty, refusing to import a snapshot onto it", ledgerID)
+	}
+
+	return store.importSnapshot(dir, metadata)
+}
+
+// importSnapshot replays the blocks and pvt data files in lock step, in block-number order,
+// committing one block (and whatever pvt data accompanies it) at a time via CommitWithPvtData.
+// The hash check inside CommitWithPvtData is skipped: the snapshot's own file-level hashes were
+// already verified by the caller. The snapshot does not carry the missing-pvtdata reconciliation
+// backlog, so a ledger bootstrapped from one starts with no outstanding missing-data entries --
+// an operator relying on CreateFromSnapshot is expected to trust the source peer's pvt data
+// wholesale rather than reconcile it.
+func (store *Store) importSnapshot(dir string, metadata *SnapshotMetadata) error {
+	store.SkipPvtDataHashCheck = true
+	defer func() { store.SkipPvtDataHashCheck = false }()
+
+	blocksFile, err := os.Open(filepath.Join(dir, snapshotBlocksFileName))
+	if err != nil {
+		return err
+	}
+	defer blocksFile.Close()
+	blocksReader := bufio.NewReader(blocksFile)
+
+	pvtdataFile, err := os.Open(filepath.Join(dir, snapshotPvtdataFileName))
+	if err != nil {
+		return err
+	}
+	defer pvtdataFile.Close()
+	pvtdataReader := bufio.NewReader(pvtdataFile)
+
+	nextPvtdataBlockNum, nextPvtdataTxNum, nextPvtdataBytes, err := readSnapshotPvtdataRecord(pvtdataReader)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	pvtdataExhausted := err == io.EOF
+
+	for blockNum := uint64(0); blockNum < metadata.LedgerHeight; blockNum++ {
+		blockBytes, err := readLengthPrefixed(blocksReader)
+		if err != nil {
+			return err
+		}
+		block := &common.Block{}
+		if err := proto.Unmarshal(blockBytes, block); err != nil {
+			return err
+		}
+
+		blockAndPvtdata := &ledger.BlockAndPvtData{Block: block, PvtData: ledger.TxPvtDataMap{}}
+		for !pvtdataExhausted && nextPvtdataBlockNum == blockNum {
+			writeSet := &rwset.TxPvtReadWriteSet{}
+			if err := proto.Unmarshal(nextPvtdataBytes, writeSet); err != nil {
+				return err
+			}
+			blockAndPvtdata.PvtData[nextPvtdataTxNum] = &ledger.TxPvtData{
+				SeqInBlock: nextPvtdataTxNum,
+				WriteSet:   writeSet,
+			}
+			nextPvtdataBlockNum, nextPvtdataTxNum, nextPvtdataBytes, err = readSnapshotPvtdataRecord(pvtdataReader)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			pvtdataExhausted = err == io.EOF
+		}
+
+		if err := store.CommitWithPvtData(blockAndPvtdata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLengthPrefixed(w io.Writer, data []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeSnapshotPvtdataRecord writes one pvtdata.data record: blockNum and txNum (8 bytes each,
+// big-endian), followed by the length-prefixed marshaled TxPvtReadWriteSet.
+func writeSnapshotPvtdataRecord(w io.Writer, blockNum, txNum uint64, writeSetBytes []byte) error {
+	var keyBuf [16]byte
+	binary.BigEndian.PutUint64(keyBuf[0:8], blockNum)
+	binary.BigEndian.PutUint64(keyBuf[8:16], txNum)
+	if _, err := w.Write(keyBuf[:]); err != nil {
+		return err
+	}
+	return writeLengthPrefixed(w, writeSetBytes)
+}
+
+// readSnapshotPvtdataRecord reads one pvtdata.data record written by writeSnapshotPvtdataRecord,
+// returning io.EOF (with no other fields populated) once the file is exhausted.
+func readSnapshotPvtdataRecord(r io.Reader) (blockNum, txNum uint64, writeSetBytes []byte, err error) {
+	var keyBuf [16]byte
+	if _, err := io.ReadFull(r, keyBuf[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	writeSetBytes, err = readLengthPrefixed(r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint64(keyBuf[0:8]), binary.BigEndian.Uint64(keyBuf[8:16]), writeSetBytes, nil
+}
+
+func verifyFileHash(file string, expectedHash []byte) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	if !bytes.Equal(hasher.Sum(nil), expectedHash) {
+		return errors.Errorf("hash mismatch for file [%s]", file)
+	}
+	return nil
+}
@@ -405,6 +405,216 @@ func TestConstructPvtdataMap(t *testing.T) {
 	assert.Nil(t, constructPvtdataMap(nil))
 }
 
+func TestCommitWithPvtDataHashMismatch(t *testing.T) {
+	storeDir, err := ioutil.TempDir("", "lstore")
+	if err != nil {
+		t.Fatalf("Failed to create ledger storage directory: %s", err)
+	}
+	defer os.RemoveAll(storeDir)
+	conf := buildPrivateDataConfig(storeDir)
+	blockStoreDir := filepath.Join(storeDir, "chains")
+	provider := NewProvider(blockStoreDir, conf, metricsProvider)
+	defer provider.Close()
+	store, err := provider.Open("testLedger")
+	assert.NoError(t, err)
+	store.Init(btlPolicyForSampleData())
+	defer store.Shutdown()
+
+	sampleData := sampleDataWithPvtdataForSelectiveTx(t)
+	// tamper with the rwset of tx 3 in block 2 so that it no longer matches the
+	// hash recorded in the block's public rwset
+	sampleData[2].PvtData[3].WriteSet.NsPvtRwset[0].CollectionPvtRwset[0].Rwset = []byte("tampered-rwset")
+
+	for _, sampleDatum := range sampleData {
+		assert.NoError(t, store.CommitWithPvtData(sampleDatum))
+	}
+
+	// the tampered collection must not have been persisted to the pvt store ...
+	pvtdata, err := store.GetPvtDataByNum(2, nil)
+	assert.NoError(t, err)
+	constructed := constructPvtdataMap(pvtdata)
+	tx3, ok := constructed[3]
+	assert.True(t, ok)
+	assert.Len(t, tx3.WriteSet.NsPvtRwset, 0)
+
+	// ... and instead shows up as missing data, eligible for reconciliation
+	missingDataInfo, err := store.GetMissingPvtDataInfoForMostRecentBlocks(10)
+	assert.NoError(t, err)
+	expected := make(ledger.MissingPvtDataInfo)
+	expected.Add(2, 3, "ns-1", "coll-1")
+	expected.Add(5, 4, "ns-4", "coll-4")
+	expected.Add(5, 5, "ns-5", "coll-5")
+	assert.Equal(t, expected, missingDataInfo)
+}
+
+// TestCommitWithPvtDataHashCheckAcceptsExistingFixtures pins down the assumption that every
+// pre-existing test in this package relies on: samplePvtData's untampered output hashes to
+// exactly what testutil.ConstructTestBlocks records in a transaction's public rwset, for every
+// txNum that those tests exercise. If that ever stops being true, CommitWithPvtData's mandatory
+// hash check (added alongside SkipPvtDataHashCheck) would start silently dropping pvtdata that
+// the rest of this file's tests expect to find, so this is guarded explicitly here rather than
+// left to be noticed incidentally by those tests failing.
+func TestCommitWithPvtDataHashCheckAcceptsExistingFixtures(t *testing.T) {
+	storeDir, err := ioutil.TempDir("", "lstore")
+	if err != nil {
+		t.Fatalf("Failed to create ledger storage directory: %s", err)
+	}
+	defer os.RemoveAll(storeDir)
+	conf := buildPrivateDataConfig(storeDir)
+	blockStoreDir := filepath.Join(storeDir, "chains")
+	provider := NewProvider(blockStoreDir, conf, metricsProvider)
+	defer provider.Close()
+	store, err := provider.Open("testLedger")
+	assert.NoError(t, err)
+	store.Init(btlPolicyForSampleData())
+	defer store.Shutdown()
+
+	// sampleDataWithPvtdataForAllTxs is the fixture TestCrashAfterPvtdataStoreCommit,
+	// TestAddAfterPvtdataStoreError and TestAddAfterBlkStoreError all commit unmodified; none of
+	// them should see any collection dropped by the hash check.
+	sampleData := sampleDataWithPvtdataForAllTxs(t)
+	for _, sampleDatum := range sampleData {
+		assert.NoError(t, store.CommitWithPvtData(sampleDatum))
+	}
+	missingDataInfo, err := store.GetMissingPvtDataInfoForMostRecentBlocks(len(sampleData))
+	assert.NoError(t, err)
+	assert.Len(t, missingDataInfo, 0)
+
+	for _, sampleDatum := range sampleData {
+		pvtdata, err := store.GetPvtDataByNum(sampleDatum.Block.Header.Number, nil)
+		assert.NoError(t, err)
+		constructed := constructPvtdataMap(pvtdata)
+		for txNum, expected := range sampleDatum.PvtData {
+			actual, ok := constructed[txNum]
+			assert.True(t, ok)
+			assert.True(t, proto.Equal(expected.WriteSet, actual.WriteSet))
+		}
+	}
+}
+
+func TestCommitPvtDataOfOldBlocks(t *testing.T) {
+	storeDir, err := ioutil.TempDir("", "lstore")
+	if err != nil {
+		t.Fatalf("Failed to create ledger storage directory: %s", err)
+	}
+	defer os.RemoveAll(storeDir)
+	conf := buildPrivateDataConfig(storeDir)
+	blockStoreDir := filepath.Join(storeDir, "chains")
+	provider := NewProvider(blockStoreDir, conf, metricsProvider)
+	defer provider.Close()
+	store, err := provider.Open("testLedger")
+	assert.NoError(t, err)
+	store.Init(btlPolicyForSampleData())
+	defer store.Shutdown()
+
+	// commit all the sample blocks; the pvtdata of (block 2, tx 3) and (block 3, tx 4) is
+	// already committed along with them
+	sampleData := sampleDataWithPvtdataForSelectiveTx(t)
+	for _, sampleDatum := range sampleData {
+		assert.NoError(t, store.CommitWithPvtData(sampleDatum))
+	}
+
+	// the reconciler supplies a mix of a correct reconstruction of the pvtdata for
+	// (block 2, tx 3) and a tampered one for (block 3, tx 4). Only the correct entry
+	// should end up in the pvtdataStore; the tampered one should surface as a mismatch.
+	correctPvtData := samplePvtData(t, []uint64{3})[3]
+	tamperedPvtData := samplePvtData(t, []uint64{4})[4]
+	tamperedPvtData.WriteSet.NsPvtRwset[0].CollectionPvtRwset[0].Rwset = []byte("tampered-rwset")
+
+	reconciledPvtdata := map[uint64][]*ledger.TxPvtData{
+		2: {correctPvtData},
+		3: {tamperedPvtData},
+	}
+
+	mismatches, err := store.CommitPvtDataOfOldBlocks(reconciledPvtdata)
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, uint64(3), mismatches[0].BlockNum)
+	assert.Equal(t, uint64(4), mismatches[0].TxNum)
+
+	assertCommitPvtDataOfOldBlocksContent := func() {
+		// the correct reconstruction for (block 2, tx 3) must be reflected in the pvt store
+		pvtdata, err := store.GetPvtDataByNum(2, nil)
+		assert.NoError(t, err)
+		tx3, ok := constructPvtdataMap(pvtdata)[3]
+		assert.True(t, ok)
+		assert.True(t, proto.Equal(correctPvtData.WriteSet, tx3.WriteSet))
+
+		// the tampered reconstruction for (block 3, tx 4) must not have overwritten what
+		// was already committed there
+		pvtdata, err = store.GetPvtDataByNum(3, nil)
+		assert.NoError(t, err)
+		tx4, ok := constructPvtdataMap(pvtdata)[4]
+		assert.True(t, ok)
+		assert.NotEqual(t, []byte("tampered-rwset"), tx4.WriteSet.NsPvtRwset[0].CollectionPvtRwset[0].Rwset)
+	}
+	assertCommitPvtDataOfOldBlocksContent()
+
+	// re-committing the same reconciled data should be a no-op
+	mismatches, err = store.CommitPvtDataOfOldBlocks(reconciledPvtdata)
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+	assertCommitPvtDataOfOldBlocksContent()
+}
+
+func TestExportAndCreateFromSnapshot(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "lstore")
+	if err != nil {
+		t.Fatalf("Failed to create ledger storage directory: %s", err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	srcDir := filepath.Join(rootDir, "src")
+	conf := buildPrivateDataConfig(srcDir)
+	srcProvider := NewProvider(filepath.Join(srcDir, "chains"), conf, metricsProvider)
+	defer srcProvider.Close()
+	srcStore, err := srcProvider.Open("testLedger")
+	assert.NoError(t, err)
+	srcStore.Init(btlPolicyForSampleData())
+	defer srcStore.Shutdown()
+
+	sampleData := sampleDataWithPvtdataForSelectiveTx(t)
+	for _, sampleDatum := range sampleData {
+		assert.NoError(t, srcStore.CommitWithPvtData(sampleDatum))
+	}
+
+	snapshotDir := filepath.Join(rootDir, "snapshot")
+	assert.NoError(t, os.MkdirAll(snapshotDir, 0755))
+	metadata, err := srcStore.ExportSnapshot(snapshotDir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), metadata.LedgerHeight)
+
+	destDir := filepath.Join(rootDir, "dest")
+	destProvider := NewProvider(filepath.Join(destDir, "chains"), buildPrivateDataConfig(destDir), metricsProvider)
+	defer destProvider.Close()
+	assert.NoError(t, destProvider.CreateFromSnapshot(snapshotDir, "testLedger"))
+
+	destStore, err := destProvider.Open("testLedger")
+	assert.NoError(t, err)
+	defer destStore.Shutdown()
+
+	for blockNum := uint64(0); blockNum < 10; blockNum++ {
+		srcBlockAndPvtdata, err := srcStore.GetPvtDataAndBlockByNum(blockNum, nil)
+		assert.NoError(t, err)
+		destBlockAndPvtdata, err := destStore.GetPvtDataAndBlockByNum(blockNum, nil)
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(srcBlockAndPvtdata.Block, destBlockAndPvtdata.Block))
+		assert.Equal(t, len(srcBlockAndPvtdata.PvtData), len(destBlockAndPvtdata.PvtData))
+		for txNum, txPvtData := range srcBlockAndPvtdata.PvtData {
+			assert.True(t, proto.Equal(txPvtData.WriteSet, destBlockAndPvtdata.PvtData[txNum].WriteSet))
+		}
+	}
+
+	// a snapshot does not carry the missing-pvtdata reconciliation backlog, so a ledger
+	// bootstrapped from one starts without any outstanding missing-data entries
+	destMissing, err := destStore.GetMissingPvtDataInfoForMostRecentBlocks(10)
+	assert.NoError(t, err)
+	assert.Len(t, destMissing, 0)
+
+	// importing onto an already-populated ledger must be refused
+	assert.Error(t, destProvider.CreateFromSnapshot(snapshotDir, "testLedger"))
+}
+
 func sampleDataWithPvtdataForSelectiveTx(t *testing.T) []*ledger.BlockAndPvtData {
 	var blockAndpvtdata []*ledger.BlockAndPvtData
 	blocks := testutil.ConstructTestBlocks(t, 10)
@@ -448,29 +658,37 @@ func sampleDataWithPvtdataForAllTxs(t *testing.T) []*ledger.BlockAndPvtData {
 }
 
 func samplePvtData(t *testing.T, txNums []uint64) map[uint64]*ledger.TxPvtData {
-	pvtWriteSet := &rwset.TxPvtReadWriteSet{DataModel: rwset.TxReadWriteSet_KV}
-	pvtWriteSet.NsPvtRwset = []*rwset.NsPvtReadWriteSet{
-		{
-			Namespace: "ns-1",
-			CollectionPvtRwset: []*rwset.CollectionPvtReadWriteSet{
-				{
-					CollectionName: "coll-1",
-					Rwset:          []byte("RandomBytes-PvtRWSet-ns1-coll1"),
-				},
-				{
-					CollectionName: "coll-2",
-					Rwset:          []byte("RandomBytes-PvtRWSet-ns1-coll2"),
-				},
-			},
-		},
-	}
 	var pvtData []*ledger.TxPvtData
 	for _, txNum := range txNums {
-		pvtData = append(pvtData, &ledger.TxPvtData{SeqInBlock: txNum, WriteSet: pvtWriteSet})
+		// each txNum gets its own write-set so that callers tampering with one
+		// transaction's rwset (e.g. to test hash-mismatch handling) cannot
+		// accidentally reach into another transaction's data
+		pvtData = append(pvtData, &ledger.TxPvtData{SeqInBlock: txNum, WriteSet: sampleTxPvtReadWriteSet()})
 	}
 	return constructPvtdataMap(pvtData)
 }
 
+func sampleTxPvtReadWriteSet() *rwset.TxPvtReadWriteSet {
+	return &rwset.TxPvtReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsPvtRwset: []*rwset.NsPvtReadWriteSet{
+			{
+				Namespace: "ns-1",
+				CollectionPvtRwset: []*rwset.CollectionPvtReadWriteSet{
+					{
+						CollectionName: "coll-1",
+						Rwset:          []byte("RandomBytes-PvtRWSet-ns1-coll1"),
+					},
+					{
+						CollectionName: "coll-2",
+						Rwset:          []byte("RandomBytes-PvtRWSet-ns1-coll2"),
+					},
+				},
+			},
+		},
+	}
+}
+
 func btlPolicyForSampleData() pvtdatapolicy.BTLPolicy {
 	return btltestutil.SampleBTLPolicy(
 		map[[2]string]uint64{